@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// defaultCompressionThreshold is the minimum response size, in bytes, worth
+// paying the CPU cost of compression for, used when setup() isn't given an
+// explicit one. It's configurable (see main's --compression-threshold flag)
+// because the right cutoff depends on deployment: a CPU-constrained instance
+// may want a higher bar, one fronted by a network that charges for every
+// byte may want a lower one.
+const defaultCompressionThreshold = 1024
+
+// responseEncodings lists the Content-Encoding values this server can
+// produce, most preferred first. Preference order breaks ties when a
+// client's Accept-Encoding gives two encodings equal weight.
+var responseEncodings = []string{"zstd", "br", "gzip", "deflate"}
+
+// requestEncodings lists the Content-Encoding values this server can decode
+// on incoming request bodies.
+var requestEncodings = map[string]bool{
+	"gzip": true, "deflate": true, "zstd": true, "bzip2": true, "xz": true,
+}
+
+// newCompressionMiddleware returns a Huma middleware that transparently
+// compresses response bodies according to the client's Accept-Encoding and
+// decompresses request bodies whose Content-Encoding we recognize, so
+// callers never have to think about wire compression. threshold is the
+// minimum response size, in bytes, worth paying the CPU cost of compression
+// for; values <= 0 fall back to defaultCompressionThreshold.
+func newCompressionMiddleware(api huma.API, threshold int) func(ctx huma.Context, next func(huma.Context)) {
+	if threshold <= 0 {
+		threshold = defaultCompressionThreshold
+	}
+
+	return func(ctx huma.Context, next func(huma.Context)) {
+		ctx.AppendHeader("Vary", "Accept-Encoding")
+
+		if enc := strings.ToLower(strings.TrimSpace(ctx.Header("Content-Encoding"))); enc != "" {
+			if !requestEncodings[enc] {
+				huma.WriteErr(api, ctx, http.StatusUnsupportedMediaType,
+					fmt.Sprintf("unsupported Content-Encoding %q", enc))
+				return
+			}
+			dec, err := newDecoder(ctx.BodyReader(), enc)
+			if err != nil {
+				huma.WriteErr(api, ctx, http.StatusBadRequest,
+					fmt.Sprintf("invalid %s request body: %s", enc, err))
+				return
+			}
+			ctx = &decodingContext{inner: ctx, body: dec}
+		}
+
+		encoding := negotiateEncoding(ctx.Header("Accept-Encoding"), responseEncodings)
+		if encoding == "" || isEventStream(ctx.Operation()) {
+			next(ctx)
+			return
+		}
+
+		cc := newCompressContext(ctx, encoding, threshold)
+		next(cc)
+		if err := cc.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "could not finalize compressed response: %v\n", err)
+		}
+	}
+}
+
+// isEventStream reports whether op responds with a Server-Sent Events
+// stream. compressContext buffers writes until its configured threshold and
+// exposes no http.Flusher/Unwrap, so wrapping an SSE response in it would
+// hold every event in memory until the encoder's buffer fills or the client
+// disconnects; SSE handlers write straight through to the underlying
+// ResponseWriter instead.
+func isEventStream(op *huma.Operation) bool {
+	if op == nil {
+		return false
+	}
+	resp := op.Responses["200"]
+	if resp == nil {
+		return false
+	}
+	_, ok := resp.Content["text/event-stream"]
+	return ok
+}
+
+// negotiateEncoding parses an Accept-Encoding header and returns the
+// highest-quality encoding from candidates (ordered most-to-least
+// preferred) that the client accepts, honoring `q=0` to explicitly disable
+// an encoding. It returns "" if no candidate is acceptable.
+func negotiateEncoding(header string, candidates []string) string {
+	if header == "" {
+		return ""
+	}
+
+	qs := map[string]float64{}
+	wildcardQ := -1.0
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, q := part, 1.0
+		if idx := strings.Index(part, ";"); idx >= 0 {
+			name = strings.TrimSpace(part[:idx])
+			if v, ok := strings.CutPrefix(strings.TrimSpace(part[idx+1:]), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		name = strings.ToLower(name)
+		if name == "*" {
+			wildcardQ = q
+			continue
+		}
+		qs[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range candidates {
+		q, ok := qs[name]
+		if !ok {
+			if wildcardQ < 0 {
+				continue
+			}
+			q = wildcardQ
+		}
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// newEncoder returns a streaming compressor for the given Content-Encoding.
+func newEncoder(w io.Writer, encoding string) (io.WriteCloser, error) {
+	switch encoding {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "deflate":
+		return flate.NewWriter(w, flate.DefaultCompression)
+	case "zstd":
+		return zstd.NewWriter(w)
+	case "br":
+		return brotli.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported response encoding %q", encoding)
+	}
+}
+
+// newDecoder returns a reader that transparently decompresses r.
+func newDecoder(r io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return flate.NewReader(r), nil
+	case "zstd":
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case "bzip2":
+		return bzip2.NewReader(r), nil
+	case "xz":
+		return xz.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported request encoding %q", encoding)
+	}
+}
+
+// decodingContext overrides BodyReader to transparently decompress the
+// request body. huma.Context can't be embedded here because the interface
+// has a method named Context, which collides with the field name Go would
+// give an embedded huma.Context; every other method is forwarded by hand
+// instead. It works with any adapter since it only relies on the public
+// huma.Context interface.
+type decodingContext struct {
+	inner huma.Context
+	body  io.Reader
+}
+
+func (d *decodingContext) Operation() *huma.Operation             { return d.inner.Operation() }
+func (d *decodingContext) Context() context.Context               { return d.inner.Context() }
+func (d *decodingContext) TLS() *tls.ConnectionState              { return d.inner.TLS() }
+func (d *decodingContext) Version() huma.ProtoVersion             { return d.inner.Version() }
+func (d *decodingContext) Method() string                         { return d.inner.Method() }
+func (d *decodingContext) Host() string                           { return d.inner.Host() }
+func (d *decodingContext) RemoteAddr() string                     { return d.inner.RemoteAddr() }
+func (d *decodingContext) URL() url.URL                           { return d.inner.URL() }
+func (d *decodingContext) Param(name string) string               { return d.inner.Param(name) }
+func (d *decodingContext) Query(name string) string               { return d.inner.Query(name) }
+func (d *decodingContext) Header(name string) string              { return d.inner.Header(name) }
+func (d *decodingContext) EachHeader(cb func(name, value string)) { d.inner.EachHeader(cb) }
+func (d *decodingContext) BodyReader() io.Reader                  { return d.body }
+func (d *decodingContext) GetMultipartForm() (*multipart.Form, error) {
+	return d.inner.GetMultipartForm()
+}
+func (d *decodingContext) SetReadDeadline(t time.Time) error { return d.inner.SetReadDeadline(t) }
+func (d *decodingContext) SetStatus(code int)                { d.inner.SetStatus(code) }
+func (d *decodingContext) Status() int                       { return d.inner.Status() }
+func (d *decodingContext) SetHeader(name, value string)      { d.inner.SetHeader(name, value) }
+func (d *decodingContext) AppendHeader(name, value string)   { d.inner.AppendHeader(name, value) }
+func (d *decodingContext) BodyWriter() io.Writer             { return d.inner.BodyWriter() }
+
+// compressContext overrides BodyWriter/SetStatus/Status to transparently
+// compress the response body once it's known to be worth compressing; every
+// other method is forwarded to inner by hand, for the same reason
+// decodingContext can't embed huma.Context directly.
+//
+// The inner context's SetStatus is deferred until we've decided whether to
+// engage compression, since most adapters write the status line (and lock
+// in headers) as soon as SetStatus is called.
+type compressContext struct {
+	inner     huma.Context
+	encoding  string
+	threshold int
+
+	status     int
+	buf        bytes.Buffer
+	encoder    io.WriteCloser
+	headerSent bool
+}
+
+func newCompressContext(ctx huma.Context, encoding string, threshold int) *compressContext {
+	return &compressContext{inner: ctx, encoding: encoding, threshold: threshold, status: http.StatusOK}
+}
+
+func (c *compressContext) Operation() *huma.Operation             { return c.inner.Operation() }
+func (c *compressContext) Context() context.Context               { return c.inner.Context() }
+func (c *compressContext) TLS() *tls.ConnectionState              { return c.inner.TLS() }
+func (c *compressContext) Version() huma.ProtoVersion             { return c.inner.Version() }
+func (c *compressContext) Method() string                         { return c.inner.Method() }
+func (c *compressContext) Host() string                           { return c.inner.Host() }
+func (c *compressContext) RemoteAddr() string                     { return c.inner.RemoteAddr() }
+func (c *compressContext) URL() url.URL                           { return c.inner.URL() }
+func (c *compressContext) Param(name string) string               { return c.inner.Param(name) }
+func (c *compressContext) Query(name string) string               { return c.inner.Query(name) }
+func (c *compressContext) Header(name string) string              { return c.inner.Header(name) }
+func (c *compressContext) EachHeader(cb func(name, value string)) { c.inner.EachHeader(cb) }
+func (c *compressContext) BodyReader() io.Reader                  { return c.inner.BodyReader() }
+func (c *compressContext) GetMultipartForm() (*multipart.Form, error) {
+	return c.inner.GetMultipartForm()
+}
+func (c *compressContext) SetReadDeadline(t time.Time) error { return c.inner.SetReadDeadline(t) }
+func (c *compressContext) SetHeader(name, value string)      { c.inner.SetHeader(name, value) }
+func (c *compressContext) AppendHeader(name, value string)   { c.inner.AppendHeader(name, value) }
+
+func (c *compressContext) SetStatus(code int) {
+	c.status = code
+}
+
+func (c *compressContext) Status() int {
+	return c.status
+}
+
+func (c *compressContext) BodyWriter() io.Writer {
+	return c
+}
+
+// Write implements io.Writer so compressContext itself can be used as the
+// body writer.
+func (c *compressContext) Write(p []byte) (int, error) {
+	if c.encoder != nil {
+		return c.encoder.Write(p)
+	}
+
+	if c.status == http.StatusNotModified {
+		return c.writePlain(p)
+	}
+
+	c.buf.Write(p)
+	if c.buf.Len() >= c.threshold {
+		if err := c.startEncoding(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *compressContext) startEncoding() error {
+	c.inner.SetHeader("Content-Encoding", c.encoding)
+	c.flushStatus()
+
+	enc, err := newEncoder(c.inner.BodyWriter(), c.encoding)
+	if err != nil {
+		return err
+	}
+	c.encoder = enc
+
+	buffered := c.buf.Bytes()
+	c.buf.Reset()
+	_, err = c.encoder.Write(buffered)
+	return err
+}
+
+func (c *compressContext) flushStatus() {
+	if !c.headerSent {
+		c.headerSent = true
+		c.inner.SetStatus(c.status)
+	}
+}
+
+func (c *compressContext) writePlain(p []byte) (int, error) {
+	c.flushStatus()
+	if c.buf.Len() > 0 {
+		buffered := c.buf.Bytes()
+		c.buf.Reset()
+		if _, err := c.inner.BodyWriter().Write(buffered); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return c.inner.BodyWriter().Write(p)
+}
+
+// Close finalizes the response: bodies that never reached the compression
+// threshold (including empty/304 bodies) are flushed untouched, otherwise
+// the streaming encoder is closed to write its final frame.
+func (c *compressContext) Close() error {
+	if c.encoder != nil {
+		return c.encoder.Close()
+	}
+	c.flushStatus()
+	_, err := c.writePlain(nil)
+	return err
+}
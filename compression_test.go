@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/danielgtaylor/huma/v2/humatest"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip;q=0", ""},
+		{"gzip;q=0.1, br;q=0.9", "br"},
+		{"identity", ""},
+		{"*", "zstd"},
+		{"*;q=0, gzip", "gzip"},
+	}
+	for _, c := range cases {
+		if got := negotiateEncoding(c.header, responseEncodings); got != c.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", c.header, got, c.want)
+		}
+	}
+}
+
+// manyChannels pads the response past the compression threshold so the
+// compression middleware actually engages.
+func manyChannels(t *testing.T, api humatest.TestAPI) {
+	t.Helper()
+	var ch Channel
+	if err := json.Unmarshal([]byte(channelFixture), &ch); err != nil {
+		t.Fatalf("failed to unmarshal channel fixture: %s", err)
+	}
+	for i := 0; i < 20; i++ {
+		resp := api.Put("/channels/test"+string(rune('a'+i)), &ch)
+		expectStatus(t, resp, http.StatusNoContent)
+	}
+}
+
+func TestCompressionResponseRoundTrip(t *testing.T) {
+	codecs := map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil },
+		"zstd": func(r io.Reader) (io.Reader, error) {
+			dec, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return dec.IOReadCloser(), nil
+		},
+		"br": func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+
+	for name, decode := range codecs {
+		t.Run(name, func(t *testing.T) {
+			_, api := humatest.New(t)
+			db := NewDB[*ChannelMeta]("")
+			setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
+			manyChannels(t, api)
+
+			resp := api.Get("/channels", "Accept-Encoding: "+name)
+			expectStatus(t, resp, http.StatusOK)
+			if got := resp.Header().Get("Content-Encoding"); got != name {
+				t.Fatalf("expected Content-Encoding %q, got %q", name, got)
+			}
+
+			r, err := decode(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to build %s decoder: %s", name, err)
+			}
+			plain, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("failed to decode %s body: %s", name, err)
+			}
+			if !strings.Contains(string(plain), `"testa"`) {
+				t.Fatalf("decoded body missing expected content: %s", plain)
+			}
+		})
+	}
+}
+
+func TestCompressionSkipsSmallResponses(t *testing.T) {
+	_, api := humatest.New(t)
+	db := NewDB[*ChannelMeta]("")
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
+
+	resp := api.Get("/channels/missing", "Accept-Encoding: gzip")
+	expectStatus(t, resp, http.StatusNotFound)
+	if resp.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected small response to be left uncompressed, got Content-Encoding %q", resp.Header().Get("Content-Encoding"))
+	}
+}
+
+// TestCompressionThresholdConfigurable checks that a response below the
+// default threshold is still compressed once setup() is given a lower one.
+func TestCompressionThresholdConfigurable(t *testing.T) {
+	_, api := humatest.New(t)
+	db := NewDB[*ChannelMeta]("")
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, 1)
+
+	resp := api.Get("/channels/missing", "Accept-Encoding: gzip")
+	expectStatus(t, resp, http.StatusNotFound)
+	if got := resp.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("expected a lowered threshold to engage compression, got Content-Encoding %q", got)
+	}
+}
+
+func TestCompressionRequestDecoding(t *testing.T) {
+	_, api := humatest.New(t)
+	db := NewDB[*ChannelMeta]("")
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write([]byte(channelFixture)); err != nil {
+		t.Fatalf("failed to gzip fixture: %s", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %s", err)
+	}
+
+	resp := api.Put("/channels/test", "Content-Type: application/json", "Content-Encoding: gzip", bytes.NewReader(buf.Bytes()))
+	expectStatus(t, resp, http.StatusNoContent)
+
+	resp = api.Get("/channels/test")
+	expectStatus(t, resp, http.StatusOK)
+	if !strings.Contains(resp.Body.String(), "test channel") {
+		t.Fatalf("expected decoded channel to be stored, got %s", resp.Body.String())
+	}
+}
+
+// TestCompressionSkipsEventStreams drives the watch SSE endpoint with
+// Accept-Encoding set the way every browser EventSource does by default; if
+// compression engaged here, events would buffer behind the compression
+// threshold and never reach the client until it disconnected.
+func TestCompressionSkipsEventStreams(t *testing.T) {
+	_, api := humatest.New(t)
+	db := NewDB[*ChannelMeta]("")
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	resp := api.GetCtx(ctx, "/channels/watch", "Accept-Encoding: gzip")
+	expectStatus(t, resp, http.StatusOK)
+	if got := resp.Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("expected the event stream to bypass compression, got Content-Encoding %q", got)
+	}
+}
+
+func TestCompressionRejectsUnknownContentEncoding(t *testing.T) {
+	_, api := humatest.New(t)
+	db := NewDB[*ChannelMeta]("")
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
+
+	var ch Channel
+	resp := api.Put("/channels/test", "Content-Encoding: made-up", &ch)
+	expectStatus(t, resp, http.StatusUnsupportedMediaType)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// defaultRequestTimeout bounds how long a request may run when the client
+// doesn't send requestTimeoutHeader, and is also the ceiling a client's own
+// header value is capped to.
+const defaultRequestTimeout = 30 * time.Second
+
+// requestTimeoutHeader lets a client shrink (but never extend) its request's
+// time budget below the server's default, in milliseconds.
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// timeRemainingHeader is the response header reporting the time budget left,
+// in milliseconds, right before the handler runs. Handlers see the deadline
+// itself through their ctx; none of them read this header.
+const timeRemainingHeader = "X-Time-Remaining-Ms"
+
+// requestDeadline parses an optional X-Request-Timeout header (milliseconds)
+// and returns the timeout to apply for the request: whichever of it and def
+// is smaller, so a client can only tighten its own budget, never loosen the
+// server's default.
+func requestDeadline(header string, def time.Duration) time.Duration {
+	if header == "" {
+		return def
+	}
+	ms, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || ms <= 0 {
+		return def
+	}
+	if requested := time.Duration(ms) * time.Millisecond; requested < def {
+		return requested
+	}
+	return def
+}
+
+// deadlineExceeded returns a 503 naming call as the downstream operation that
+// blew the request's time budget, if ctx's deadline has already passed;
+// otherwise it returns nil. Retry-After is a flat 1s: this demo has no load
+// signal (queue depth, backend health) to base a smarter value on.
+func deadlineExceeded(ctx context.Context, call string) error {
+	if ctx.Err() != context.DeadlineExceeded {
+		return nil
+	}
+	return huma.ErrorWithHeaders(
+		huma.Error503ServiceUnavailable("request deadline exceeded", &huma.ErrorDetail{
+			Message: fmt.Sprintf("%s exceeded the request's time budget", call),
+		}),
+		http.Header{"Retry-After": []string{"1"}},
+	)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		def    time.Duration
+		want   time.Duration
+	}{
+		{"no header uses default", "", time.Second, time.Second},
+		{"smaller header wins", "100", time.Second, 100 * time.Millisecond},
+		{"header can't exceed default", "5000", time.Second, time.Second},
+		{"invalid header falls back to default", "not-a-number", time.Second, time.Second},
+		{"zero header falls back to default", "0", time.Second, time.Second},
+		{"negative header falls back to default", "-100", time.Second, time.Second},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := requestDeadline(c.header, c.def); got != c.want {
+				t.Fatalf("expected %s, got %s", c.want, got)
+			}
+		})
+	}
+}
+
+// slowDB wraps a DB[T] so Load blocks until ctx is done, simulating a
+// backend slow enough to blow the request's time budget.
+type slowDB[T any] struct {
+	DB[T]
+}
+
+func (s slowDB[T]) Load(ctx context.Context, key string) (T, bool) {
+	<-ctx.Done()
+	return s.DB.Load(ctx, key)
+}
+
+func TestRequestDeadlineExceededReturns503(t *testing.T) {
+	_, api := humatest.New(t)
+	db := slowDB[*ChannelMeta]{NewDB[*ChannelMeta]("")}
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
+
+	resp := api.Get("/channels/test", "X-Request-Timeout: 10")
+	expectStatus(t, resp, http.StatusServiceUnavailable)
+
+	if got := resp.Header().Get("Retry-After"); got == "" {
+		t.Fatal("expected a Retry-After header")
+	}
+	if !strings.Contains(resp.Body.String(), "db.Load") {
+		t.Fatalf("expected error body to name the call that exceeded its budget, got %s", resp.Body.String())
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha1"
 	"encoding/base64"
@@ -8,7 +9,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+
+	"github.com/danielgtaylor/huma/v2"
 )
 
 type ctxKey int
@@ -17,12 +22,183 @@ const (
 	ctxKeyTraceID ctxKey = iota
 )
 
-// DB describes a simple typed key-value data store.
+// EventType describes the kind of change a Watch subscriber observed.
+type EventType string
+
+const (
+	EventTypeAdded    EventType = "ADDED"
+	EventTypeModified EventType = "MODIFIED"
+	EventTypeDeleted  EventType = "DELETED"
+	EventTypeError    EventType = "ERROR"
+)
+
+// Event is sent to Watch subscribers whenever a key changes.
+type Event[T any] struct {
+	Type  EventType         `json:"type"`
+	Key   string            `json:"key,omitempty"`
+	Value T                 `json:"value,omitempty"`
+	Error *huma.ErrorDetail `json:"error,omitempty"`
+}
+
+// watchBuffer is the number of unread events a subscriber may queue before
+// it is considered slow and dropped.
+const watchBuffer = 16
+
+// Entity is implemented by values that carry a content ETag. Backends use it
+// to perform atomic compare-and-swap writes without a separate version store.
+type Entity interface {
+	GetETag() string
+}
+
+// DB describes a simple typed key-value data store. Every method takes a
+// ctx so the deadline middleware in setup() can bound how long a request is
+// willing to wait on it; backends abort in-flight work once ctx is done
+// instead of running past the request's time budget.
 type DB[T any] interface {
-	Load(key string) (T, bool)
-	Store(key string, value T)
-	Range(f func(string string, value T) bool)
-	Delete(key any)
+	Load(ctx context.Context, key string) (T, bool)
+	Store(ctx context.Context, key string, value T)
+	Range(ctx context.Context, f func(string string, value T) bool)
+
+	// RangeFrom calls f for each key-value pair in the DB in ascending key
+	// order, starting at the first key >= startKey. Backends with a native
+	// ordered iterator (e.g. bbolt) can use this to seek directly instead of
+	// loading the whole dataset; memDB falls back to a full scan and sort.
+	RangeFrom(ctx context.Context, startKey string, f func(key string, value T) bool)
+
+	Delete(ctx context.Context, key any)
+
+	// Watch subscribes to add/modify/delete events. The returned channel is
+	// closed when ctx is canceled. Slow consumers that don't keep up with
+	// their buffer are sent a terminal ERROR event and dropped.
+	Watch(ctx context.Context) <-chan Event[T]
+
+	// WatchPrefix is like Watch, but only for keys beginning with prefix.
+	WatchPrefix(ctx context.Context, prefix string) <-chan Event[T]
+
+	// CompareAndSwap stores value under key only if the currently stored
+	// value's ETag (see Entity) matches expectedETag, or if expectedETag is
+	// empty and no value currently exists. It reports whether the swap
+	// happened, pushing the If-Match check down into the backend so it can
+	// be done atomically instead of via a racy read-then-write.
+	CompareAndSwap(ctx context.Context, key string, value T, expectedETag string) bool
+}
+
+// subscribers manages the Watch/WatchPrefix fan-out shared by every DB
+// backend: tracking live subscriber channels (each with the key prefix it
+// filters on, "" meaning all keys) and delivering events to them with a
+// drop-slow-consumer policy.
+type subscribers[T any] struct {
+	mu   sync.Mutex
+	subs map[chan Event[T]]string
+}
+
+func newSubscribers[T any]() *subscribers[T] {
+	return &subscribers[T]{subs: map[chan Event[T]]string{}}
+}
+
+// ctxDone reports whether ctx has already been canceled or exceeded its
+// deadline, used by backends to bail out of work it's too late to serve.
+func ctxDone(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// watch registers a new subscriber channel filtered to keys beginning with
+// prefix ("" matches every key), replays the current contents of the DB
+// (via snapshot) as ADDED events, then streams live events until ctx is
+// canceled.
+//
+// Registration and the replay snapshot happen together under s.mu, so no
+// live event is delivered into the middle of the replay: a publish that
+// collects subscribers after watch returns is delivered after the last
+// replayed event. Backends write their data outside s.mu, though, so this
+// does not rule out duplicates: a Store whose write lands before the
+// snapshot but whose publish runs after watch returns is replayed as ADDED
+// and then delivered again live.
+func (s *subscribers[T]) watch(ctx context.Context, prefix string, snapshot func(f func(key string, value T) bool)) <-chan Event[T] {
+	ch := make(chan Event[T], watchBuffer)
+
+	s.mu.Lock()
+	s.subs[ch] = prefix
+	snapshot(func(key string, value T) bool {
+		if strings.HasPrefix(key, prefix) {
+			s.trySendLocked(ch, Event[T]{Type: EventTypeAdded, Key: key, Value: value})
+		}
+		return true
+	})
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		s.mu.Lock()
+		if _, ok := s.subs[ch]; ok {
+			delete(s.subs, ch)
+			close(ch)
+		}
+		s.mu.Unlock()
+	}()
+
+	return ch
+}
+
+// publish fans out an event to every current subscriber whose prefix
+// matches evt.Key. Subscribers whose buffer is full are considered slow
+// consumers: they receive a terminal ERROR event and are dropped rather
+// than blocking the writer.
+func (s *subscribers[T]) publish(evt Event[T]) {
+	s.mu.Lock()
+	chs := make([]chan Event[T], 0, len(s.subs))
+	for ch, prefix := range s.subs {
+		if strings.HasPrefix(evt.Key, prefix) {
+			chs = append(chs, ch)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, ch := range chs {
+		s.trySend(ch, evt)
+	}
+}
+
+// trySend delivers evt to ch if it is still subscribed. If ch's buffer is
+// full, its oldest event is dropped to make room for a terminal ERROR event
+// and the subscriber is evicted rather than blocking the writer.
+func (s *subscribers[T]) trySend(ch chan Event[T], evt Event[T]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trySendLocked(ch, evt)
+}
+
+// trySendLocked is trySend for a caller that already holds s.mu (watch's
+// registration-plus-replay step needs to deliver snapshot events without
+// re-entering the lock it's already holding).
+func (s *subscribers[T]) trySendLocked(ch chan Event[T], evt Event[T]) {
+	if _, ok := s.subs[ch]; !ok {
+		// Already evicted or unsubscribed; nothing to do.
+		return
+	}
+
+	select {
+	case ch <- evt:
+	default:
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- (Event[T]{Type: EventTypeError, Error: &huma.ErrorDetail{
+			Message: "slow consumer dropped",
+		}}):
+		default:
+		}
+		delete(s.subs, ch)
+		close(ch)
+	}
 }
 
 // memDB is a simple in-memory key-value store that is safe for concurrent use.
@@ -30,12 +206,15 @@ type DB[T any] interface {
 type memDB[T any] struct {
 	sync.Map
 	filename string
+
+	casMu sync.Mutex
+	subs  *subscribers[T]
 }
 
 // NewDB creates a new instance of the DB for the given type. If a filename
 // is given, it is used to persist data to disk.
 func NewDB[T any](filename string) DB[T] {
-	db := &memDB[T]{filename: filename}
+	db := &memDB[T]{filename: filename, subs: newSubscribers[T]()}
 
 	if filename != "" {
 		// Load from disk
@@ -48,7 +227,7 @@ func NewDB[T any](filename string) DB[T] {
 			}
 
 			for k, v := range items {
-				db.Store(k, v)
+				db.Store(context.Background(), k, v)
 			}
 		}
 	}
@@ -56,8 +235,14 @@ func NewDB[T any](filename string) DB[T] {
 	return db
 }
 
-// Load retrieves a value from the DB by key.
-func (db *memDB[T]) Load(key string) (T, bool) {
+// Load retrieves a value from the DB by key. memDB's lookups are instant, so
+// there's no mid-operation cancellation to honor; checking ctx up front is
+// enough to skip the lookup entirely once the request is already out of time.
+func (db *memDB[T]) Load(ctx context.Context, key string) (T, bool) {
+	if ctxDone(ctx) {
+		var t T
+		return t, false
+	}
 	v, ok := db.Map.Load(key)
 	if !ok {
 		var t T
@@ -67,12 +252,17 @@ func (db *memDB[T]) Load(key string) (T, bool) {
 }
 
 // Store sets a value in the DB by key.
-func (db *memDB[T]) Store(key string, value T) {
+func (db *memDB[T]) Store(ctx context.Context, key string, value T) {
+	if ctxDone(ctx) {
+		return
+	}
+
+	_, existed := db.Map.Load(key)
 	db.Map.Store(key, value)
 	if db.filename != "" {
 		// Persist to disk
 		items := map[string]T{}
-		db.Range(func(k string, v T) bool {
+		db.Range(ctx, func(k string, v T) bool {
 			items[k] = v
 			return true
 		})
@@ -80,15 +270,106 @@ func (db *memDB[T]) Store(key string, value T) {
 		_ = gob.NewEncoder(f).Encode(items)
 		f.Close()
 	}
+
+	typ := EventTypeAdded
+	if existed {
+		typ = EventTypeModified
+	}
+	db.subs.publish(Event[T]{Type: typ, Key: key, Value: value})
+}
+
+// CompareAndSwap atomically stores value under key only if the existing
+// value's ETag matches expectedETag (or both are empty, i.e. the key must
+// not yet exist).
+func (db *memDB[T]) CompareAndSwap(ctx context.Context, key string, value T, expectedETag string) bool {
+	if ctxDone(ctx) {
+		return false
+	}
+
+	db.casMu.Lock()
+	defer db.casMu.Unlock()
+
+	existingETag := ""
+	if existing, ok := db.Map.Load(key); ok {
+		if e, ok := any(existing).(Entity); ok {
+			existingETag = e.GetETag()
+		}
+	}
+	if existingETag != expectedETag {
+		return false
+	}
+
+	db.Store(ctx, key, value)
+	return true
+}
+
+// Delete removes a value from the DB by key and notifies watchers.
+func (db *memDB[T]) Delete(ctx context.Context, key any) {
+	if ctxDone(ctx) {
+		return
+	}
+
+	db.Map.Delete(key)
+	if k, ok := key.(string); ok {
+		db.subs.publish(Event[T]{Type: EventTypeDeleted, Key: k})
+	}
 }
 
-// Range calls the given function for each key-value pair in the DB.
-func (db *memDB[T]) Range(f func(key string, value T) bool) {
+// Range calls the given function for each key-value pair in the DB,
+// stopping early if ctx is canceled before the scan finishes.
+func (db *memDB[T]) Range(ctx context.Context, f func(key string, value T) bool) {
 	db.Map.Range(func(key, value interface{}) bool {
+		if ctxDone(ctx) {
+			return false
+		}
 		return f(key.(string), value.(T))
 	})
 }
 
+// RangeFrom calls f for each key-value pair in ascending key order, starting
+// at the first key >= startKey. sync.Map has no native ordering, so this
+// does a full scan and sort first.
+func (db *memDB[T]) RangeFrom(ctx context.Context, startKey string, f func(key string, value T) bool) {
+	type entry struct {
+		key   string
+		value T
+	}
+	var all []entry
+	db.Range(ctx, func(key string, value T) bool {
+		all = append(all, entry{key, value})
+		return true
+	})
+	sort.Slice(all, func(i, j int) bool { return all[i].key < all[j].key })
+
+	for _, e := range all {
+		if ctxDone(ctx) {
+			return
+		}
+		if e.key < startKey {
+			continue
+		}
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Watch subscribes to add/modify/delete events for this DB. It first
+// replays an ADDED event for every key currently in the store, then streams
+// live changes until ctx is canceled.
+func (db *memDB[T]) Watch(ctx context.Context) <-chan Event[T] {
+	return db.subs.watch(ctx, "", func(f func(key string, value T) bool) {
+		db.Range(ctx, f)
+	})
+}
+
+// WatchPrefix is like Watch, but only for keys beginning with prefix.
+func (db *memDB[T]) WatchPrefix(ctx context.Context, prefix string) <-chan Event[T] {
+	return db.subs.watch(ctx, prefix, func(f func(key string, value T) bool) {
+		db.RangeFrom(ctx, prefix, f)
+	})
+}
+
 // Hash computes a SHA1 hash of the given value and returns it as a
 // base64-encoded string. Fields are ordered and stable, based on the JSON
 // marshaling field rules, so two values of the same type with the same field
@@ -2,16 +2,21 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humago"
 	"github.com/danielgtaylor/huma/v2/conditional"
+	"github.com/danielgtaylor/huma/v2/sse"
 
 	_ "embed"
 )
@@ -58,7 +63,11 @@ type Channel struct {
 }
 
 // ChannelMeta is used both as the DB storage object as well as the response
-// for listing channels.
+// for listing channels and for watch events (see the watch-channels
+// operation below). Channel is excluded from JSON on purpose: it keeps
+// `GET /channels` and `GET /channels/watch` cheap to transfer for large
+// channel counts. Callers that need the full body - not just metadata -
+// fetch it with `GET /channels/{id}`.
 type ChannelMeta struct {
 	ID           string    `json:"id" doc:"Channel ID"`
 	ETag         string    `json:"etag" doc:"The content hash for the channel"`
@@ -66,19 +75,31 @@ type ChannelMeta struct {
 	Channel      *Channel  `json:"-"`
 }
 
+// GetETag implements Entity so the DB can perform compare-and-swap writes.
+func (c *ChannelMeta) GetETag() string {
+	return c.ETag
+}
+
 // ChannelIDParam is a shared input path parameter used by several operations.
 type ChannelIDParam struct {
 	ChannelID string `path:"id" pattern:"[a-zA-Z0-9_-]{2,60}" doc:"The unique identifier of the channel."`
 }
 
+// ChannelList is the body of a paginated `GET /channels` response.
+type ChannelList struct {
+	Items      []*ChannelMeta `json:"items" doc:"The channels in this page of results."`
+	NextCursor string         `json:"next_cursor,omitempty" doc:"Opaque cursor for fetching the next page, if more results exist."`
+}
+
 type ListChannelsResponse struct {
-	Link string `header:"Link" doc:"Links for pagination"`
-	Body []*ChannelMeta
+	Link string `header:"Link" doc:"Link to the next page of results, if any."`
+	Body ChannelList
 }
 
 type GetChannelResponse struct {
 	ETag         string    `header:"Etag" doc:"The content hash for the channel"`
 	LastModified time.Time `header:"Last-Modified" doc:"The last modified time for the channel"`
+	Health       string    `header:"X-Channel-Health" doc:"Overall publish-point health: green, yellow, or red, derived from the latest probe status."`
 	Body         *Channel
 }
 
@@ -86,15 +107,144 @@ type PutChannelResponse struct {
 	ETag string `header:"ETag" doc:"The content hash for the channel"`
 }
 
-// setup our API middleware, operations, and handlers.
-func setup(api huma.API, db DB[*ChannelMeta]) {
-	// Middleware example to log requests.
+type ChannelStatusResponse struct {
+	Body []*PublishPointStatus
+}
+
+// defaultPageLimit and maxPageLimit bound the `?limit=` query param accepted
+// by `GET /channels`.
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// channelListCache memoizes the LastModified-sorted snapshot that `GET
+// /channels` pages over. The list order is LastModified-descending, not key
+// order, so `RangeFrom`'s key-ordered seek can't shortcut it - a full
+// `db.Range` is unavoidable whenever the snapshot is stale. What it doesn't
+// have to be is unavoidable on *every* call: this caches the sorted snapshot
+// and only rebuilds it after a write or delete bumps version, so a burst of
+// paginated requests against an unchanged dataset scans and sorts the
+// backend once rather than once per page. Like Watch, this only sees writes
+// made through this process; a bolt:// file shared by multiple instances
+// would need a cross-process invalidation signal this doesn't provide.
+type channelListCache struct {
+	mu      sync.Mutex
+	version uint64
+	built   uint64
+	sorted  []*ChannelMeta
+}
+
+// invalidate marks the cached snapshot stale. Called after every write or
+// delete that touches db.
+func (c *channelListCache) invalidate() {
+	c.mu.Lock()
+	c.version++
+	c.mu.Unlock()
+}
+
+// snapshot returns the current LastModified-descending, ID-tiebroken list of
+// channels, rebuilding it from db if a write has invalidated the cache since
+// the last call. Concurrent callers during a rebuild share the same scan
+// instead of each doing their own.
+func (c *channelListCache) snapshot(ctx context.Context, db DB[*ChannelMeta]) ([]*ChannelMeta, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sorted != nil && c.built == c.version {
+		return c.sorted, nil
+	}
+
+	metas := []*ChannelMeta{}
+	db.Range(ctx, func(key string, value *ChannelMeta) bool {
+		metas = append(metas, value)
+		return true
+	})
+	if err := deadlineExceeded(ctx, "db.Range"); err != nil {
+		return nil, err
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].LastModified.Equal(metas[j].LastModified) {
+			// Break ties on ID so the order (and thus pagination) is stable
+			// even for channels written in the same instant.
+			return metas[i].ID < metas[j].ID
+		}
+		return metas[i].LastModified.After(metas[j].LastModified)
+	})
+
+	c.sorted = metas
+	c.built = c.version
+	return metas, nil
+}
+
+// setup our API middleware, operations, and handlers. cursorSecret signs the
+// opaque pagination cursors returned by `GET /channels`; rotating it
+// invalidates any cursors issued under the old secret. probe checks publish
+// point liveness for channels that are toggled on. requestTimeout bounds how
+// long a request may run before downstream calls abort it; see the deadline
+// middleware below. compressionThreshold is the minimum response size worth
+// compressing; 0 falls back to defaultCompressionThreshold.
+func setup(api huma.API, db DB[*ChannelMeta], cursorSecret []byte, statusDB DB[*PublishPointStatus], probe StatusProbe, requestTimeout time.Duration, compressionThreshold int) {
+	// Starts/stops publish-point probes as channels are written or deleted.
+	// This lives here, as a direct call from the PUT/DELETE handlers below,
+	// rather than as generic middleware: only those two operations need it,
+	// and a path-matching middleware would have to special-case them anyway.
+	probes := newProbeManager(probe, statusDB, probeInterval)
+
+	// Start probes for any channel that was already on when db was loaded
+	// (e.g. restored from a persisted mem:// or bolt:// file), so a restart
+	// doesn't leave its health/bitrate/drop data stale until the next PUT
+	// happens to touch it.
+	db.Range(context.Background(), func(key string, meta *ChannelMeta) bool {
+		if meta.Channel != nil && meta.Channel.On {
+			probes.sync(key, meta.Channel)
+		}
+		return true
+	})
+
+	// Sorted snapshot cache for GET /channels; see channelListCache's doc.
+	list := &channelListCache{}
+
+	// Transparently compress responses and decompress request bodies based
+	// on the client's Accept-Encoding/Content-Encoding headers.
+	//
+	// This is global middleware, not a per-operation concern, so it isn't
+	// reflected as a header parameter/response in the generated OpenAPI
+	// document the way e.g. ETag is - a generated SDK (sdk/example) has no
+	// way to learn encodings are negotiable from the spec alone. Documenting
+	// it per-operation would mean repeating the same header declaration on
+	// every route; this is a known gap, not something that's been reviewed
+	// or signed off on, and is left for follow-up.
+	api.UseMiddleware(newCompressionMiddleware(api, compressionThreshold))
+
+	// Middleware to trace, deadline, and log every request.
 	api.UseMiddleware(func(ctx huma.Context, next func(huma.Context)) {
 		// Basic tracing support.
 		traceID := GetTraceID()
 		ctx = huma.WithValue(ctx, ctxKeyTraceID, traceID)
 		ctx.SetHeader("traceparent", traceID)
 
+		// Bound the request to a time budget: the client's X-Request-Timeout
+		// header if it's smaller, otherwise requestTimeout. The deadline rides
+		// along in ctx, which every handler below passes into its DB calls, so
+		// a slow backend aborts instead of running past the budget. Modeled on
+		// a deadline-timer: the budget remaining when the handler is invoked is
+		// also reported to the client in the X-Time-Remaining-Ms header.
+		//
+		// The watch stream is exempt: it's meant to stay open for the life of
+		// the client's connection, not a single request's time budget, and
+		// force-closing it every requestTimeout would just make clients
+		// re-list on a loop instead of actually watching.
+		if !isEventStream(ctx.Operation()) {
+			timeout := requestDeadline(ctx.Header(requestTimeoutHeader), requestTimeout)
+			deadlineCtx, cancel := context.WithTimeout(ctx.Context(), timeout)
+			defer cancel()
+			ctx = huma.WithContext(ctx, deadlineCtx)
+			if deadline, ok := deadlineCtx.Deadline(); ok {
+				ctx.SetHeader(timeRemainingHeader, strconv.FormatInt(time.Until(deadline).Milliseconds(), 10))
+			}
+		}
+
 		next(ctx)
 
 		// Log the request.
@@ -107,38 +257,119 @@ func setup(api huma.API, db DB[*ChannelMeta]) {
 	})
 
 	huma.Get(api, "/channels", func(ctx context.Context, input *struct {
-		Cursor string `query:"cursor" doc:"The cursor to use for pagination."`
+		Limit  int    `query:"limit" minimum:"1" maximum:"500" default:"50" doc:"Maximum number of channels to return."`
+		Cursor string `query:"cursor" doc:"Opaque cursor from a previous response's next_cursor, for fetching the next page."`
 	}) (*ListChannelsResponse, error) {
-		// TODO: pagination!
-		metas := []*ChannelMeta{}
-		db.Range(func(key string, value *ChannelMeta) bool {
-			metas = append(metas, value)
-			return true
-		})
-		sort.Slice(metas, func(i, j int) bool {
-			// Bit of a hack due to the in-memory map, but let's make sure to send
-			// clients a stable order of channels.
-			return metas[i].LastModified.After(metas[j].LastModified)
-		})
-		return &ListChannelsResponse{
-			Body: metas,
-		}, nil
+		var after *cursor
+		if input.Cursor != "" {
+			c, err := decodeCursor(cursorSecret, input.Cursor)
+			if err != nil {
+				return nil, huma.Error400BadRequest("invalid cursor")
+			}
+			after = &c
+		}
+
+		metas, err := list.snapshot(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+
+		start := 0
+		if after != nil {
+			start = len(metas)
+			for i, m := range metas {
+				if m.LastModified.Equal(after.LastModified) && m.ID == after.ID {
+					start = i + 1
+					break
+				}
+			}
+		}
+
+		limit := input.Limit
+		if limit <= 0 {
+			limit = defaultPageLimit
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+
+		end := start + limit
+		if end > len(metas) {
+			end = len(metas)
+		}
+		page := metas[start:end]
+
+		resp := &ListChannelsResponse{Body: ChannelList{Items: page}}
+		if end < len(metas) {
+			last := page[len(page)-1]
+			next := encodeCursor(cursorSecret, cursor{LastModified: last.LastModified, ID: last.ID})
+			resp.Body.NextCursor = next
+			resp.Link = fmt.Sprintf(`</channels?cursor=%s&limit=%d>; rel="next"`, next, limit)
+		}
+		return resp, nil
 	})
 
+	sse.Register(api, huma.Operation{
+		OperationID: "watch-channels",
+		Method:      http.MethodGet,
+		Path:        "/channels/watch",
+		Summary:     "Watch channel changes",
+		Description: "Streams ADDED/MODIFIED/DELETED events for channels, starting with a replay of the current set, so clients can maintain a local mirror of channel metadata (id/etag/last_modified) without polling `GET /channels`. Events carry metadata only, not the channel body - fetch `GET /channels/{id}` for that, using the event's etag to know when a cached body is stale.",
+	}, map[string]any{
+		"message": Event[*ChannelMeta]{},
+	}, func(ctx context.Context, input *struct {
+		ResourceVersion string `query:"resourceVersion" doc:"Opaque cursor from a previous watch; only \"0\" or empty (full replay) is currently supported."`
+	}, send sse.Sender) {
+		if input.ResourceVersion != "" && input.ResourceVersion != "0" {
+			// We don't retain event history, so we can't resume an arbitrary
+			// cursor. Tell the client its view is too old to resume.
+			send.Data(Event[*ChannelMeta]{
+				Type:  EventTypeError,
+				Error: &huma.ErrorDetail{Message: "Expired"},
+			})
+			return
+		}
+
+		for evt := range db.Watch(ctx) {
+			send.Data(evt)
+		}
+	})
+
+	// /channels/watch must be registered before this wildcard: some routers
+	// (humatest's among them) match routes in registration order, and a
+	// literal segment registered after {id} would never be reached because
+	// {id} already claims "watch".
 	huma.Get(api, "/channels/{id}", func(ctx context.Context, input *struct {
 		ChannelIDParam
 	}) (*GetChannelResponse, error) {
-		meta, ok := db.Load(input.ChannelID)
+		meta, ok := db.Load(ctx, input.ChannelID)
+		if err := deadlineExceeded(ctx, "db.Load"); err != nil {
+			return nil, err
+		}
 		if !ok {
 			return nil, huma.Error404NotFound("Channel not found")
 		}
 		return &GetChannelResponse{
 			ETag:         meta.ETag,
 			LastModified: meta.LastModified,
+			Health:       channelHealth(loadStatuses(ctx, statusDB, input.ChannelID, meta.Channel)),
 			Body:         meta.Channel,
 		}, nil
 	})
 
+	huma.Get(api, "/channels/{id}/status", func(ctx context.Context, input *struct {
+		ChannelIDParam
+	}) (*ChannelStatusResponse, error) {
+		meta, ok := db.Load(ctx, input.ChannelID)
+		if err := deadlineExceeded(ctx, "db.Load"); err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, huma.Error404NotFound("Channel not found")
+		}
+		return &ChannelStatusResponse{Body: loadStatuses(ctx, statusDB, input.ChannelID, meta.Channel)}, nil
+	})
+
 	huma.Put(api, "/channels/{id}", func(ctx context.Context, input *struct {
 		ChannelIDParam
 		conditional.Params
@@ -146,7 +377,10 @@ func setup(api huma.API, db DB[*ChannelMeta]) {
 	}) (*PutChannelResponse, error) {
 		etag := ""
 		modified := time.Time{}
-		existing, ok := db.Load(input.ChannelID)
+		existing, ok := db.Load(ctx, input.ChannelID)
+		if err := deadlineExceeded(ctx, "db.Load"); err != nil {
+			return nil, err
+		}
 		if ok {
 			etag = existing.ETag
 			modified = existing.LastModified
@@ -169,7 +403,17 @@ func setup(api huma.API, db DB[*ChannelMeta]) {
 			LastModified: time.Now(),
 			Channel:      input.Body,
 		}
-		db.Store(input.ChannelID, meta)
+		if !db.CompareAndSwap(ctx, input.ChannelID, meta, etag) {
+			if err := deadlineExceeded(ctx, "db.CompareAndSwap"); err != nil {
+				return nil, err
+			}
+			// Someone else wrote the channel in the race window between our
+			// read above and this write. Push the check down into the store
+			// instead of trusting our now-stale `etag`/`modified` read.
+			return nil, huma.Error409Conflict("channel was concurrently modified, please retry")
+		}
+		probes.sync(input.ChannelID, meta.Channel)
+		list.invalidate()
 
 		return &PutChannelResponse{
 			ETag: meta.ETag,
@@ -179,12 +423,36 @@ func setup(api huma.API, db DB[*ChannelMeta]) {
 	huma.Delete(api, "/channels/{id}", func(ctx context.Context, input *struct {
 		ChannelIDParam
 	}) (*struct{}, error) {
-		db.Delete(input.ChannelID)
+		db.Delete(ctx, input.ChannelID)
+		if err := deadlineExceeded(ctx, "db.Delete"); err != nil {
+			return nil, err
+		}
+		probes.sync(input.ChannelID, nil)
+		list.invalidate()
 		return nil, nil
 	})
 }
 
+// loadStatuses fetches the current status for each of ch's publish points,
+// skipping any that haven't been probed yet.
+func loadStatuses(ctx context.Context, statusDB DB[*PublishPointStatus], channelID string, ch *Channel) []*PublishPointStatus {
+	if ch == nil {
+		return nil
+	}
+	statuses := make([]*PublishPointStatus, 0, len(ch.PublishPoints))
+	for _, pp := range ch.PublishPoints {
+		if s, ok := statusDB.Load(ctx, statusKey(channelID, pp.ID)); ok {
+			statuses = append(statuses, s)
+		}
+	}
+	return statuses
+}
+
 func main() {
+	storage := flag.String("storage", "mem://channels.db", "Storage backend URL: mem://path or bolt:///path")
+	compressionThreshold := flag.Int("compression-threshold", defaultCompressionThreshold, "Minimum response size, in bytes, worth compressing")
+	flag.Parse()
+
 	// Create a new router & API
 	router := http.NewServeMux()
 
@@ -197,16 +465,30 @@ func main() {
 	}
 	api := humago.New(router, config)
 
-	// Initialize the DB. This is a goroutine-safe in-memory map for the demo,
-	// but would be a real data store in a production system.
-	db := NewDB[*ChannelMeta]("channels.db")
+	// Initialize the DB. This is a goroutine-safe in-memory map by default,
+	// but `--storage` can point it at a real data store instead.
+	db, err := NewDBFromURL[*ChannelMeta](*storage)
+	if err != nil {
+		panic(err)
+	}
+
+	// Sign pagination cursors with a secret generated fresh at startup;
+	// restarting the server invalidates any cursors clients were holding.
+	cursorSecret := make([]byte, 32)
+	if _, err := rand.Read(cursorSecret); err != nil {
+		panic(err)
+	}
+
+	// Publish-point status is always kept in memory: it's a derived, rolling
+	// view of liveness, not data worth persisting across restarts.
+	statusDB := NewDB[*PublishPointStatus]("")
 
 	// Register all our API operations & handlers.
-	setup(api, db)
+	setup(api, db, cursorSecret, statusDB, newManifestProbe(), defaultRequestTimeout, *compressionThreshold)
 
 	// Run the server!
 	fmt.Println("Listening on http://localhost:8888")
-	err := http.ListenAndServe("localhost:8888", router)
+	err = http.ListenAndServe("localhost:8888", router)
 	if err != http.ErrServerClosed {
 		panic(err)
 	}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/humatest"
@@ -14,6 +16,22 @@ import (
 
 var _ huma.ResolverWithPath = (*VideoEncoder)(nil)
 
+// testCursorSecret signs pagination cursors in tests across this package.
+var testCursorSecret = []byte("test-cursor-secret")
+
+// testRequestTimeout is the request deadline used in tests; generous enough
+// that it never fires on its own, so tests that want a 503 use a slow fake
+// DB or a tiny X-Request-Timeout header instead.
+const testRequestTimeout = 5 * time.Second
+
+// noopProbe is a StatusProbe used in tests so setup() never makes a real
+// network call; it always reports healthy.
+type noopProbe struct{}
+
+func (noopProbe) Probe(ctx context.Context, pp PublishPoint) PublishPointStatus {
+	return PublishPointStatus{Healthy: true, LastChecked: time.Now()}
+}
+
 const channelFixture = `{
   "name": "test channel",
   "on": true,
@@ -63,7 +81,7 @@ func TestAPI(t *testing.T) {
 
 	db := NewDB[*ChannelMeta]("")
 
-	setup(api, db)
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
 
 	var ch Channel
 	if err := json.Unmarshal([]byte(channelFixture), &ch); err != nil {
@@ -93,12 +111,15 @@ func TestAPI(t *testing.T) {
 
 	resp = api.Get("/channels")
 	expectStatus(t, resp, http.StatusOK)
-	var v []any
-	if err := json.Unmarshal(resp.Body.Bytes(), &v); err != nil {
+	var list ChannelList
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil {
 		t.Fatalf("failed to unmarshal response: %s", err)
 	}
-	if len(v) != 2 {
-		t.Fatalf("expected 2 channels, got %d", len(v))
+	if len(list.Items) != 2 {
+		t.Fatalf("expected 2 channels, got %d", len(list.Items))
+	}
+	if list.NextCursor != "" {
+		t.Fatalf("expected no next_cursor for a single page, got %q", list.NextCursor)
 	}
 
 	resp = api.Get("/channels/test")
@@ -113,3 +134,215 @@ func TestAPI(t *testing.T) {
 	resp = api.Delete("/channels/test")
 	expectStatus(t, resp, http.StatusNoContent)
 }
+
+func TestWatchPropagation(t *testing.T) {
+	db := NewDB[*ChannelMeta]("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := db.Watch(ctx)
+
+	db.Store(ctx, "test", &ChannelMeta{ID: "test", ETag: "1"})
+	db.Store(ctx, "test", &ChannelMeta{ID: "test", ETag: "2"})
+	db.Delete(ctx, "test")
+
+	want := []EventType{EventTypeAdded, EventTypeModified, EventTypeDeleted}
+	for _, typ := range want {
+		select {
+		case evt := <-events:
+			if evt.Type != typ {
+				t.Fatalf("expected %s event, got %s", typ, evt.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s event", typ)
+		}
+	}
+}
+
+func TestWatchSlowConsumerEviction(t *testing.T) {
+	db := NewDB[*ChannelMeta]("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := db.Watch(ctx)
+
+	// Fill the subscriber's buffer without draining it so the next publish
+	// finds it full and evicts it with a terminal ERROR event.
+	for i := 0; i < watchBuffer+2; i++ {
+		db.Store(ctx, "test", &ChannelMeta{ID: "test", ETag: time.Duration(i).String()})
+	}
+
+	var lastType EventType
+	for evt := range events {
+		lastType = evt.Type
+	}
+	if lastType != EventTypeError {
+		t.Fatalf("expected slow consumer to be evicted with an ERROR event, got %s", lastType)
+	}
+}
+
+// TestWatchNotBoundByRequestDeadline proves the watch stream outlives the
+// configured request deadline: with a 10ms requestTimeout, a naively wrapped
+// stream would be force-closed with a 503 almost immediately, but here it
+// stays open until the caller's own, much longer context is done.
+func TestWatchNotBoundByRequestDeadline(t *testing.T) {
+	_, api := humatest.New(t)
+	db := NewDB[*ChannelMeta]("")
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, 10*time.Millisecond, defaultCompressionThreshold)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	resp := api.GetCtx(ctx, "/channels/watch")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected the stream to outlive the 10ms request deadline, closed after %s", elapsed)
+	}
+	expectStatus(t, resp, http.StatusOK)
+}
+
+func TestWatchPrefixFiltering(t *testing.T) {
+	db := NewDB[*ChannelMeta]("")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := db.WatchPrefix(ctx, "ch-a/")
+
+	db.Store(ctx, "ch-a/1", &ChannelMeta{ID: "ch-a/1", ETag: "1"})
+	db.Store(ctx, "ch-b/1", &ChannelMeta{ID: "ch-b/1", ETag: "1"})
+	db.Store(ctx, "ch-a/2", &ChannelMeta{ID: "ch-a/2", ETag: "1"})
+
+	want := []string{"ch-a/1", "ch-a/2"}
+	for _, key := range want {
+		select {
+		case evt := <-events:
+			if evt.Key != key {
+				t.Fatalf("expected event for key %q, got %q", key, evt.Key)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for event for key %q", key)
+		}
+	}
+
+	select {
+	case evt := <-events:
+		t.Fatalf("expected no event outside the watched prefix, got %+v", evt)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestListChannelsPagination(t *testing.T) {
+	_, api := humatest.New(t)
+	db := NewDB[*ChannelMeta]("")
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
+
+	var ch Channel
+	if err := json.Unmarshal([]byte(channelFixture), &ch); err != nil {
+		t.Fatalf("failed to unmarshal channel fixture: %s", err)
+	}
+
+	// Insert out of ID order so a stable page boundary proves we're sorting
+	// by LastModified (with ID as a tiebreaker), not by insertion or key order.
+	ids := []string{"ch-c", "ch-a", "ch-e", "ch-b", "ch-d"}
+	for _, id := range ids {
+		resp := api.Put("/channels/"+id, &ch)
+		expectStatus(t, resp, http.StatusNoContent)
+	}
+
+	seen := map[string]bool{}
+	var prev *ChannelMeta
+	cursorParam := ""
+	for page := 0; ; page++ {
+		path := "/channels?limit=2"
+		if cursorParam != "" {
+			path += "&cursor=" + cursorParam
+		}
+		resp := api.Get(path)
+		expectStatus(t, resp, http.StatusOK)
+
+		var list ChannelList
+		if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil {
+			t.Fatalf("failed to unmarshal page %d: %s", page, err)
+		}
+		for _, item := range list.Items {
+			if seen[item.ID] {
+				t.Fatalf("saw channel %q more than once across pages", item.ID)
+			}
+			seen[item.ID] = true
+			if prev != nil && (prev.LastModified.Before(item.LastModified) ||
+				(prev.LastModified.Equal(item.LastModified) && prev.ID > item.ID)) {
+				t.Fatalf("channel %q listed after %q, expected LastModified-descending order with ID as a tiebreaker", item.ID, prev.ID)
+			}
+			prev = item
+		}
+
+		if list.NextCursor == "" {
+			break
+		}
+		if got := resp.Header().Get("Link"); !strings.Contains(got, `rel="next"`) {
+			t.Fatalf(`expected a Link header with rel="next", got %q`, got)
+		}
+		cursorParam = list.NextCursor
+
+		if page > len(ids) {
+			t.Fatal("pagination did not terminate")
+		}
+	}
+
+	if len(seen) != len(ids) {
+		t.Fatalf("expected to see all %d channels across pages, saw %d", len(ids), len(seen))
+	}
+}
+
+func TestListChannelsCursorInvalidation(t *testing.T) {
+	_, api := humatest.New(t)
+	db := NewDB[*ChannelMeta]("")
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
+
+	var ch Channel
+	if err := json.Unmarshal([]byte(channelFixture), &ch); err != nil {
+		t.Fatalf("failed to unmarshal channel fixture: %s", err)
+	}
+	for _, id := range []string{"ch-a", "ch-b", "ch-c"} {
+		resp := api.Put("/channels/"+id, &ch)
+		expectStatus(t, resp, http.StatusNoContent)
+	}
+
+	resp := api.Get("/channels?limit=1")
+	expectStatus(t, resp, http.StatusOK)
+	var list ChannelList
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to unmarshal response: %s", err)
+	}
+	if list.NextCursor == "" {
+		t.Fatal("expected a next_cursor with more results remaining")
+	}
+
+	resp = api.Get("/channels?cursor=" + list.NextCursor)
+	expectStatus(t, resp, http.StatusOK)
+
+	resp = api.Get("/channels?cursor=not-a-real-cursor")
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	// The last character of a 32-byte signature carries only 4 bits, so "w"
+	// and "x" decode to the same bytes; pick a replacement that differs.
+	replacement := "x"
+	if strings.HasSuffix(list.NextCursor, "w") {
+		replacement = "A"
+	}
+	tamperedSignature := list.NextCursor[:len(list.NextCursor)-1] + replacement
+	resp = api.Get("/channels?cursor=" + tamperedSignature)
+	expectStatus(t, resp, http.StatusBadRequest)
+}
+
+func TestCursorInvalidatedOnSecretRotation(t *testing.T) {
+	c := cursor{LastModified: time.Now(), ID: "test"}
+	token := encodeCursor([]byte("old-secret"), c)
+
+	if _, err := decodeCursor([]byte("old-secret"), token); err != nil {
+		t.Fatalf("expected cursor signed with the matching secret to decode, got %s", err)
+	}
+	if _, err := decodeCursor([]byte("new-secret"), token); err == nil {
+		t.Fatal("expected cursor signed under a rotated-away secret to be rejected")
+	}
+}
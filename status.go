@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeInterval is how often a publish point is probed.
+const probeInterval = 15 * time.Second
+
+// statusWindow is the rolling window of samples a publish point's status is
+// aggregated over.
+const statusWindow = 5 * time.Minute
+
+// PublishPointStatus is the aggregated health of a single publish point over
+// the last statusWindow, as last observed by a StatusProbe.
+type PublishPointStatus struct {
+	ChannelID      string `json:"channel_id" doc:"The channel this publish point belongs to."`
+	PublishPointID string `json:"publish_point_id" doc:"The publish point this status describes."`
+
+	Healthy         bool      `json:"healthy" doc:"Whether the most recent probe succeeded."`
+	LastSegmentPush time.Time `json:"last_segment_push,omitempty" doc:"Timestamp read from the manifest's own timing tag: the last #EXT-X-PROGRAM-DATE-TIME for HLS, availabilityStartTime (the stream's start) for DASH."`
+	LatencyMs       int64     `json:"latency_ms,omitempty" doc:"End-to-end latency in milliseconds, computed from the manifest's timing tag."`
+	BitrateKbps     uint32    `json:"bitrate_kbps,omitempty" doc:"Bitrate advertised by the manifest, if any."`
+	DroppedSegments uint32    `json:"dropped_segments" doc:"Number of failed probes within the rolling window."`
+	DRMErrors       uint32    `json:"drm_errors" doc:"DRM license fetch errors within the rolling window. Always 0 today: this demo's probe checks manifest reachability only and does not fetch DRM licenses."`
+	LastChecked     time.Time `json:"last_checked" doc:"When this publish point was last probed."`
+	LastError       string    `json:"last_error,omitempty" doc:"The error from the most recent failed probe, if any."`
+}
+
+// statusKey builds the statusDB key for a channel's publish point.
+func statusKey(channelID, publishPointID string) string {
+	return channelID + "/" + publishPointID
+}
+
+// StatusProbe checks the live health of a single publish point. Implementations
+// fill in everything, LastChecked included, but ChannelID/PublishPointID,
+// which the caller sets.
+type StatusProbe interface {
+	Probe(ctx context.Context, pp PublishPoint) PublishPointStatus
+}
+
+var (
+	hlsProgramDateTime = regexp.MustCompile(`(?m)^#EXT-X-PROGRAM-DATE-TIME:(\S+)`)
+	hlsBandwidth       = regexp.MustCompile(`BANDWIDTH=(\d+)`)
+	dashAvailability   = regexp.MustCompile(`availabilityStartTime="([^"]+)"`)
+	dashBandwidth      = regexp.MustCompile(`bandwidth="(\d+)"`)
+)
+
+// manifestProbe is a StatusProbe for HLS/DASH publish points. The request
+// that motivated this asked for a HEAD check, but the latency we need to
+// report comes from a tag inside the manifest body, so this fetches the
+// manifest with GET; a plain reachability check would've been a HEAD, but
+// we already need the body for latency, so one request covers both.
+type manifestProbe struct {
+	client *http.Client
+}
+
+func newManifestProbe() *manifestProbe {
+	return &manifestProbe{client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (p *manifestProbe) Probe(ctx context.Context, pp PublishPoint) PublishPointStatus {
+	status := PublishPointStatus{LastChecked: time.Now()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pp.URL, nil)
+	if err != nil {
+		status.LastError = err.Error()
+		return status
+	}
+	for k, v := range pp.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		status.LastError = err.Error()
+		return status
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		status.LastError = fmt.Sprintf("manifest returned %s", resp.Status)
+		return status
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		status.LastError = err.Error()
+		return status
+	}
+
+	status.Healthy = true
+	switch pp.Format {
+	case "dash":
+		parseDASHStatus(body, &status)
+	default:
+		parseHLSStatus(body, &status)
+	}
+	return status
+}
+
+func parseHLSStatus(body []byte, status *PublishPointStatus) {
+	if m := hlsProgramDateTime.FindAllSubmatch(body, -1); len(m) > 0 {
+		if t, err := time.Parse(time.RFC3339, string(m[len(m)-1][1])); err == nil {
+			status.LastSegmentPush = t
+			status.LatencyMs = time.Since(t).Milliseconds()
+		}
+	}
+	if m := hlsBandwidth.FindSubmatch(body); m != nil {
+		if n, err := strconv.ParseUint(string(m[1]), 10, 32); err == nil {
+			status.BitrateKbps = uint32(n) / 1000
+		}
+	}
+}
+
+func parseDASHStatus(body []byte, status *PublishPointStatus) {
+	if m := dashAvailability.FindSubmatch(body); m != nil {
+		if t, err := time.Parse(time.RFC3339, string(m[1])); err == nil {
+			status.LastSegmentPush = t
+			status.LatencyMs = time.Since(t).Milliseconds()
+		}
+	}
+	if m := dashBandwidth.FindSubmatch(body); m != nil {
+		if n, err := strconv.ParseUint(string(m[1]), 10, 32); err == nil {
+			status.BitrateKbps = uint32(n) / 1000
+		}
+	}
+}
+
+// probeManager starts and stops per-publish-point probe goroutines as
+// channels are toggled on/off, aggregating each publish point's samples over
+// statusWindow into a single PublishPointStatus in statusDB.
+type probeManager struct {
+	probe    StatusProbe
+	statusDB DB[*PublishPointStatus]
+	interval time.Duration
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func newProbeManager(probe StatusProbe, statusDB DB[*PublishPointStatus], interval time.Duration) *probeManager {
+	return &probeManager{
+		probe:    probe,
+		statusDB: statusDB,
+		interval: interval,
+		cancels:  map[string]context.CancelFunc{},
+	}
+}
+
+// sync starts probes for any publish point in ch that isn't already being
+// probed, and stops any running probe for a publish point no longer present.
+// Passing a nil or off channel stops every probe for channelID.
+func (m *probeManager) sync(channelID string, ch *Channel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := map[string]PublishPoint{}
+	if ch != nil && ch.On {
+		for _, pp := range ch.PublishPoints {
+			wanted[statusKey(channelID, pp.ID)] = pp
+		}
+	}
+
+	prefix := channelID + "/"
+	for key, cancel := range m.cancels {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if _, ok := wanted[key]; !ok {
+			cancel()
+			delete(m.cancels, key)
+			m.statusDB.Delete(context.Background(), key)
+		}
+	}
+
+	for key, pp := range wanted {
+		if _, ok := m.cancels[key]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		m.cancels[key] = cancel
+		go m.run(ctx, channelID, pp)
+	}
+}
+
+func (m *probeManager) run(ctx context.Context, channelID string, pp PublishPoint) {
+	key := statusKey(channelID, pp.ID)
+	windowSize := int(statusWindow/m.interval) + 1
+	samples := make([]PublishPointStatus, 0, windowSize)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		sample := m.probe.Probe(ctx, pp)
+		sample.ChannelID = channelID
+		sample.PublishPointID = pp.ID
+
+		samples = append(samples, sample)
+		cutoff := time.Now().Add(-statusWindow)
+		for len(samples) > 0 && samples[0].LastChecked.Before(cutoff) {
+			samples = samples[1:]
+		}
+
+		m.statusDB.Store(ctx, key, aggregateStatus(samples))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// aggregateStatus summarizes a publish point's samples from the current
+// rolling window into the single snapshot stored in statusDB.
+func aggregateStatus(samples []PublishPointStatus) *PublishPointStatus {
+	latest := samples[len(samples)-1]
+	agg := latest
+
+	// DroppedSegments and DRMErrors are rolled up fresh from every sample in
+	// the window (including latest itself), not carried over from it like the
+	// rest of agg's fields, so they must start at zero here or latest's own
+	// contribution gets counted twice.
+	agg.DroppedSegments = 0
+	agg.DRMErrors = 0
+
+	for _, s := range samples {
+		if !s.Healthy {
+			agg.DroppedSegments++
+		}
+		agg.DRMErrors += s.DRMErrors
+	}
+
+	return &agg
+}
+
+// channelHealth derives the `X-Channel-Health` value from a channel's
+// current publish point statuses: green if all are healthy, red if none
+// are, yellow otherwise (including when nothing has been probed yet).
+func channelHealth(statuses []*PublishPointStatus) string {
+	if len(statuses) == 0 {
+		return "yellow"
+	}
+
+	healthy := 0
+	for _, s := range statuses {
+		if s.Healthy {
+			healthy++
+		}
+	}
+
+	switch {
+	case healthy == len(statuses):
+		return "green"
+	case healthy == 0:
+		return "red"
+	default:
+		return "yellow"
+	}
+}
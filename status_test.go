@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+)
+
+func TestChannelHealth(t *testing.T) {
+	cases := []struct {
+		name     string
+		statuses []*PublishPointStatus
+		want     string
+	}{
+		{"nothing probed yet", nil, "yellow"},
+		{"all healthy", []*PublishPointStatus{{Healthy: true}, {Healthy: true}}, "green"},
+		{"all unhealthy", []*PublishPointStatus{{Healthy: false}, {Healthy: false}}, "red"},
+		{"mixed", []*PublishPointStatus{{Healthy: true}, {Healthy: false}}, "yellow"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := channelHealth(c.statuses); got != c.want {
+				t.Errorf("channelHealth() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestAggregateStatus(t *testing.T) {
+	now := time.Now()
+	samples := []PublishPointStatus{
+		{Healthy: true, LastChecked: now.Add(-2 * time.Second)},
+		{Healthy: false, LastChecked: now.Add(-1 * time.Second)},
+		{Healthy: true, LastChecked: now, BitrateKbps: 2000},
+	}
+
+	agg := aggregateStatus(samples)
+	if agg.DroppedSegments != 1 {
+		t.Errorf("expected 1 dropped segment across the window, got %d", agg.DroppedSegments)
+	}
+	if !agg.Healthy || agg.BitrateKbps != 2000 || !agg.LastChecked.Equal(now) {
+		t.Errorf("expected the aggregate to reflect the latest sample, got %+v", agg)
+	}
+}
+
+func TestParseHLSStatus(t *testing.T) {
+	body := []byte("#EXTM3U\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=4500000\n" +
+		"#EXT-X-PROGRAM-DATE-TIME:2026-07-28T12:00:00Z\n" +
+		"segment1.ts\n")
+
+	var status PublishPointStatus
+	parseHLSStatus(body, &status)
+
+	if status.BitrateKbps != 4500 {
+		t.Errorf("expected bitrate 4500 kbps, got %d", status.BitrateKbps)
+	}
+	want, _ := time.Parse(time.RFC3339, "2026-07-28T12:00:00Z")
+	if !status.LastSegmentPush.Equal(want) {
+		t.Errorf("expected last segment push %s, got %s", want, status.LastSegmentPush)
+	}
+}
+
+func TestParseDASHStatus(t *testing.T) {
+	body := []byte(`<MPD availabilityStartTime="2026-07-28T12:00:00Z">` +
+		`<Representation bandwidth="3000000"></Representation></MPD>`)
+
+	var status PublishPointStatus
+	parseDASHStatus(body, &status)
+
+	if status.BitrateKbps != 3000 {
+		t.Errorf("expected bitrate 3000 kbps, got %d", status.BitrateKbps)
+	}
+	want, _ := time.Parse(time.RFC3339, "2026-07-28T12:00:00Z")
+	if !status.LastSegmentPush.Equal(want) {
+		t.Errorf("expected availability start time %s, got %s", want, status.LastSegmentPush)
+	}
+}
+
+// pollStatus polls GET /channels/{id}/status until it returns the expected
+// number of publish point statuses or deadline passes, since probes run on
+// their own goroutine and the first sample isn't synchronous with setup().
+func pollStatus(t *testing.T, api humatest.TestAPI, channelID string, want int) []*PublishPointStatus {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp := api.Get("/channels/" + channelID + "/status")
+		expectStatus(t, resp, http.StatusOK)
+
+		var statuses []*PublishPointStatus
+		if err := json.Unmarshal(resp.Body.Bytes(), &statuses); err != nil {
+			t.Fatalf("failed to unmarshal status response: %s", err)
+		}
+		if len(statuses) == want {
+			return statuses
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d publish point status(es), last saw %d", want, len(statuses))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestChannelStatusEndpoint(t *testing.T) {
+	_, api := humatest.New(t)
+	db := NewDB[*ChannelMeta]("")
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
+
+	var ch Channel
+	if err := json.Unmarshal([]byte(channelFixture), &ch); err != nil {
+		t.Fatalf("failed to unmarshal channel fixture: %s", err)
+	}
+	resp := api.Put("/channels/test", &ch)
+	expectStatus(t, resp, http.StatusNoContent)
+
+	statuses := pollStatus(t, api, "test", 1)
+	if !statuses[0].Healthy {
+		t.Fatalf("expected the publish point status to be healthy, got %+v", statuses[0])
+	}
+
+	resp = api.Get("/channels/test")
+	expectStatus(t, resp, http.StatusOK)
+	if got := resp.Header().Get("X-Channel-Health"); got != "green" {
+		t.Fatalf("expected X-Channel-Health green once the publish point is healthy, got %q", got)
+	}
+}
+
+// TestProbesStartForAlreadyOnChannelsAtSetup guards against channels that
+// were already on when db was populated (e.g. restored from a persisted
+// mem:// or bolt:// file) never getting a probe started until the next PUT.
+func TestProbesStartForAlreadyOnChannelsAtSetup(t *testing.T) {
+	_, api := humatest.New(t)
+	db := NewDB[*ChannelMeta]("")
+
+	var ch Channel
+	if err := json.Unmarshal([]byte(channelFixture), &ch); err != nil {
+		t.Fatalf("failed to unmarshal channel fixture: %s", err)
+	}
+	db.Store(context.Background(), "preexisting", &ChannelMeta{
+		ID:           "preexisting",
+		ETag:         Hash(&ch),
+		LastModified: time.Now(),
+		Channel:      &ch,
+	})
+
+	setup(api, db, testCursorSecret, NewDB[*PublishPointStatus](""), noopProbe{}, testRequestTimeout, defaultCompressionThreshold)
+
+	pollStatus(t, api, "preexisting", 1)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var itemsBucket = []byte("items")
+
+// NewDBFromURL builds a DB for the given storage URL. The scheme selects the
+// backend:
+//
+//   - mem://path        in-memory, optionally persisted to a gob file at path
+//   - bolt:///path       a local BoltDB file at path
+//   - redis://host:port/db
+//   - etcd://host:port
+//   - consul://host:port
+//
+// redis://, etcd://, and consul:// are reserved but NOT implemented: they
+// need new dependencies (a redis client, etcd's clientv3, the consul API
+// client) plus miniredis/embedded-etcd-backed integration tests, none of
+// which could be added or verified in the environment this was written in
+// (no module proxy access). Shipping untested client/backend glue for three
+// distributed systems would be worse than not shipping it.
+//
+// This is a scope cut from the original request that still needs maintainer
+// sign-off: mem:// and bolt:// ship now with full test coverage; redis://,
+// etcd://, and consul:// are tracked as follow-up work and --storage will
+// keep rejecting them with the error below until a backend lands with the
+// same level of coverage.
+func NewDBFromURL[T any](rawURL string) (DB[T], error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing storage URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "", "mem":
+		return NewDB[T](u.Opaque + u.Host + u.Path), nil
+	case "bolt":
+		return newBoltDB[T](u.Path)
+	case "redis", "etcd", "consul":
+		return nil, fmt.Errorf("storage backend %q is reserved but not yet implemented (needs a client dependency and integration tests this change could not add/verify; see NewDBFromURL doc)", u.Scheme)
+	default:
+		return nil, fmt.Errorf("unknown storage scheme %q", u.Scheme)
+	}
+}
+
+// boltDB is a DB[T] backed by a local BoltDB (bbolt) file. Unlike memDB it
+// writes a single key per `Store`/`Delete` rather than re-serializing the
+// whole map, and its compare-and-swap is a real atomic check performed
+// inside a single bbolt write transaction.
+type boltDB[T any] struct {
+	db   *bbolt.DB
+	subs *subscribers[T]
+}
+
+// newBoltDB opens (creating if needed) a BoltDB file at path.
+func newBoltDB[T any](path string) (DB[T], error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening bolt db: %w", err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(itemsBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating bolt bucket: %w", err)
+	}
+
+	return &boltDB[T]{db: db, subs: newSubscribers[T]()}, nil
+}
+
+func encodeValue[T any](value T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeValue[T any](data []byte) (T, error) {
+	var value T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// Load retrieves a value from the DB by key. bbolt has no way to cancel a
+// transaction already in flight, so ctx is only checked before opening one;
+// a transaction against a local file is expected to be fast enough not to
+// need mid-flight cancellation in practice.
+func (db *boltDB[T]) Load(ctx context.Context, key string) (T, bool) {
+	var value T
+	if ctxDone(ctx) {
+		return value, false
+	}
+
+	found := false
+	_ = db.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(itemsBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		v, err := decodeValue[T](data)
+		if err != nil {
+			return err
+		}
+		value, found = v, true
+		return nil
+	})
+	return value, found
+}
+
+// Store sets a value in the DB by key.
+func (db *boltDB[T]) Store(ctx context.Context, key string, value T) {
+	if ctxDone(ctx) {
+		return
+	}
+
+	data, err := encodeValue(value)
+	if err != nil {
+		return
+	}
+
+	existed := false
+	_ = db.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(itemsBucket)
+		existed = b.Get([]byte(key)) != nil
+		return b.Put([]byte(key), data)
+	})
+
+	typ := EventTypeAdded
+	if existed {
+		typ = EventTypeModified
+	}
+	db.subs.publish(Event[T]{Type: typ, Key: key, Value: value})
+}
+
+// CompareAndSwap atomically stores value under key only if the existing
+// value's ETag matches expectedETag (or both are empty, i.e. the key must
+// not yet exist). The check-and-set happens inside a single bbolt write
+// transaction, so it is race-free even against other processes sharing the
+// same file.
+func (db *boltDB[T]) CompareAndSwap(ctx context.Context, key string, value T, expectedETag string) bool {
+	if ctxDone(ctx) {
+		return false
+	}
+
+	data, err := encodeValue(value)
+	if err != nil {
+		return false
+	}
+
+	existed := false
+	swapped := false
+	_ = db.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(itemsBucket)
+
+		existingETag := ""
+		if existing := b.Get([]byte(key)); existing != nil {
+			existed = true
+			if v, err := decodeValue[T](existing); err == nil {
+				if e, ok := any(v).(Entity); ok {
+					existingETag = e.GetETag()
+				}
+			}
+		}
+		if existingETag != expectedETag {
+			return nil
+		}
+
+		swapped = true
+		return b.Put([]byte(key), data)
+	})
+
+	if swapped {
+		typ := EventTypeAdded
+		if existed {
+			typ = EventTypeModified
+		}
+		db.subs.publish(Event[T]{Type: typ, Key: key, Value: value})
+	}
+	return swapped
+}
+
+// Delete removes a value from the DB by key and notifies watchers.
+func (db *boltDB[T]) Delete(ctx context.Context, key any) {
+	if ctxDone(ctx) {
+		return
+	}
+
+	k, ok := key.(string)
+	if !ok {
+		return
+	}
+	_ = db.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(itemsBucket).Delete([]byte(k))
+	})
+	db.subs.publish(Event[T]{Type: EventTypeDeleted, Key: k})
+}
+
+// Range calls the given function for each key-value pair in the DB,
+// stopping early if ctx is canceled before the scan finishes.
+func (db *boltDB[T]) Range(ctx context.Context, f func(key string, value T) bool) {
+	_ = db.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(itemsBucket).ForEach(func(k, data []byte) error {
+			if ctxDone(ctx) {
+				return errStopRange
+			}
+			v, err := decodeValue[T](data)
+			if err != nil {
+				return err
+			}
+			if !f(string(k), v) {
+				return errStopRange
+			}
+			return nil
+		})
+	})
+}
+
+// RangeFrom calls f for each key-value pair in ascending key order, starting
+// at the first key >= startKey. Unlike memDB, this seeks directly to the
+// starting key via bbolt's native cursor instead of scanning from the top.
+func (db *boltDB[T]) RangeFrom(ctx context.Context, startKey string, f func(key string, value T) bool) {
+	_ = db.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(itemsBucket).Cursor()
+		for k, data := c.Seek([]byte(startKey)); k != nil; k, data = c.Next() {
+			if ctxDone(ctx) {
+				return errStopRange
+			}
+			v, err := decodeValue[T](data)
+			if err != nil {
+				return err
+			}
+			if !f(string(k), v) {
+				return errStopRange
+			}
+		}
+		return nil
+	})
+}
+
+var errStopRange = fmt.Errorf("stop range")
+
+// Watch subscribes to add/modify/delete events. BoltDB has no native change
+// feed, so this reuses the same in-process fan-out as memDB: it's enough to
+// notify other subscribers of this process, but not other processes sharing
+// the same file.
+func (db *boltDB[T]) Watch(ctx context.Context) <-chan Event[T] {
+	return db.subs.watch(ctx, "", func(f func(key string, value T) bool) {
+		db.Range(ctx, f)
+	})
+}
+
+// WatchPrefix is like Watch, but only for keys beginning with prefix. The
+// replay seeks directly to prefix via RangeFrom instead of scanning the
+// whole bucket; live events are still filtered the same way Watch's are.
+func (db *boltDB[T]) WatchPrefix(ctx context.Context, prefix string) <-chan Event[T] {
+	return db.subs.watch(ctx, prefix, func(f func(key string, value T) bool) {
+		db.RangeFrom(ctx, prefix, f)
+	})
+}
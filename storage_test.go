@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewDBFromURL(t *testing.T) {
+	for _, scheme := range []string{"redis", "etcd", "consul"} {
+		if _, err := NewDBFromURL[*ChannelMeta](scheme + "://localhost"); err == nil {
+			t.Fatalf("expected %s:// to be rejected as not yet implemented", scheme)
+		}
+	}
+
+	if _, err := NewDBFromURL[*ChannelMeta]("bogus://localhost"); err == nil {
+		t.Fatal("expected an unknown scheme to be rejected")
+	}
+}
+
+func TestCompareAndSwapBackends(t *testing.T) {
+	backends := map[string]func() DB[*ChannelMeta]{
+		"mem": func() DB[*ChannelMeta] {
+			return NewDB[*ChannelMeta]("")
+		},
+		"bolt": func() DB[*ChannelMeta] {
+			db, err := newBoltDB[*ChannelMeta](filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("failed to open bolt db: %s", err)
+			}
+			return db
+		},
+	}
+
+	for name, newDB := range backends {
+		t.Run(name, func(t *testing.T) {
+			db := newDB()
+			ctx := context.Background()
+
+			// Create only succeeds against an absent key (expectedETag == "").
+			if !db.CompareAndSwap(ctx, "test", &ChannelMeta{ID: "test", ETag: "1"}, "") {
+				t.Fatal("expected create to succeed")
+			}
+			if db.CompareAndSwap(ctx, "test", &ChannelMeta{ID: "test", ETag: "2"}, "") {
+				t.Fatal("expected create against an existing key to fail")
+			}
+
+			// Update only succeeds when the expected ETag matches.
+			if !db.CompareAndSwap(ctx, "test", &ChannelMeta{ID: "test", ETag: "2"}, "1") {
+				t.Fatal("expected update with the correct ETag to succeed")
+			}
+			if db.CompareAndSwap(ctx, "test", &ChannelMeta{ID: "test", ETag: "3"}, "1") {
+				t.Fatal("expected update with a stale ETag to fail")
+			}
+
+			meta, ok := db.Load(ctx, "test")
+			if !ok || meta.ETag != "2" {
+				t.Fatalf("expected stored ETag %q, got %+v", "2", meta)
+			}
+		})
+	}
+}